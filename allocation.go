@@ -0,0 +1,304 @@
+package turn
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gortc.io/stun"
+	gturn "gortc.io/turn"
+
+	"github.com/trustkeys/turn/nat"
+)
+
+// relayBufferSize bounds a single Read off a Permission's pipe before
+// it's forwarded to the peer as one Send indication or ChannelData
+// frame.
+const relayBufferSize = 1500
+
+// Permission represents an installed permission for a peer address,
+// optionally bound to a channel number.
+type Permission struct {
+	peerAddr gturn.PeerAddress
+	binding  gturn.ChannelNumber
+	peerL    net.Conn // local end of the pipe, fed by the client
+
+	bytesSent int64
+	bytesRecv int64
+}
+
+// Binding returns the channel number bound to the permission, or zero
+// if the permission has no channel binding.
+func (p *Permission) Binding() gturn.ChannelNumber { return p.binding }
+
+var allocSeq int64
+
+// Allocation represents a single TURN allocation obtained from the
+// server and the set of peer permissions installed on it.
+//
+// A Client may hold several allocations at once; each is identified by
+// ID and keeps its own relayed-transport-address so inbound data can be
+// routed to the allocation it belongs to. Per RFC 5766 Section 6.2 a
+// server rejects a second Allocate on an already-allocated five-tuple,
+// so every Allocation past the first carries its own dedicated
+// transport (tr); the first reuses the Client's primary connection and
+// leaves tr nil.
+type Allocation struct {
+	id        string
+	client    *Client
+	tr        *clientTransport // dedicated transport, nil for the primary allocation
+	log       *zap.Logger
+	relayed   gturn.RelayedAddress // XOR-RELAYED-ADDRESS, cached at allocation time
+	expiresAt time.Time            // zero if the server didn't return a Lifetime
+
+	mux   sync.RWMutex
+	perms []*Permission
+
+	// natGW and natPort record the NAT mapping Client.publishNATMapping
+	// installed for this allocation's connection, if any, so Close can
+	// delete it again instead of leaking a port forward on the router.
+	natGW   nat.Interface
+	natPort int
+
+	// reconnectMux serializes Client.reconnectAllocation the same way
+	// Client.reconnectMux serializes Client.reconnect, so a concurrent
+	// readAllocation failure and refreshLoop failure on this allocation
+	// don't redial and reallocate over each other.
+	reconnectMux sync.Mutex
+}
+
+// stunClient returns the STUN client this allocation sends requests
+// over: its own dedicated one if it was opened via AllocationDialer, or
+// the Client's primary one otherwise.
+func (a *Allocation) stunClient() STUNClient {
+	if a.tr != nil {
+		return a.tr.stun
+	}
+	return a.client.stun
+}
+
+// scheduler returns the egress scheduler backing this allocation's
+// channels.
+func (a *Allocation) scheduler() *scheduler {
+	if a.tr != nil {
+		return a.tr.sched
+	}
+	return a.client.sched
+}
+
+// do sends req over the allocation's own STUN client, so requests for a
+// secondary allocation are never sent on a five-tuple the server has
+// already bound to a different allocation.
+func (a *Allocation) do(req, res *stun.Message) error {
+	return a.client.doWith(a.stunClient(), req, res)
+}
+
+// ID returns the identifier the Client assigned to this allocation.
+func (a *Allocation) ID() string { return a.id }
+
+// RelayedAddress returns the relayed-transport-address the server
+// allocated for this allocation.
+func (a *Allocation) RelayedAddress() gturn.RelayedAddress { return a.relayed }
+
+func newAllocation(c *Client, relayed gturn.RelayedAddress) *Allocation {
+	id := atomic.AddInt64(&allocSeq, 1)
+	return &Allocation{
+		id:      fmt.Sprintf("%s/%d", relayed, id),
+		client:  c,
+		log:     c.log.Named("allocation"),
+		relayed: relayed,
+	}
+}
+
+// handleData delivers a Data indication payload to every permission
+// installed for addr on this allocation.
+func (a *Allocation) handleData(addr gturn.PeerAddress, data gturn.Data) {
+	a.mux.RLock()
+	defer a.mux.RUnlock()
+	for _, p := range a.perms {
+		if !gturn.Addr(p.peerAddr).Equal(gturn.Addr(addr)) {
+			continue
+		}
+		if _, err := p.peerL.Write(data); err != nil {
+			a.log.Error("failed to write", zap.Error(err))
+			continue
+		}
+		atomic.AddInt64(&p.bytesRecv, int64(len(data)))
+		atomic.AddInt64(&a.client.stats.bytesRecv, int64(len(data)))
+		atomic.AddInt64(&a.client.stats.packetsRecv, 1)
+	}
+}
+
+// handleChannelData delivers a ChannelData payload to the permission
+// bound to its channel number on this allocation.
+func (a *Allocation) handleChannelData(data *gturn.ChannelData) {
+	a.mux.RLock()
+	defer a.mux.RUnlock()
+	for _, p := range a.perms {
+		if data.Number != p.Binding() {
+			continue
+		}
+		if _, err := p.peerL.Write(data.Data); err != nil {
+			a.log.Error("failed to write", zap.Error(err))
+			continue
+		}
+		atomic.AddInt64(&p.bytesRecv, int64(len(data.Data)))
+		atomic.AddInt64(&a.client.stats.bytesRecv, int64(len(data.Data)))
+		atomic.AddInt64(&a.client.stats.packetsRecv, 1)
+		a.scheduler().recordRecv(data.Number, len(data.Data))
+	}
+}
+
+// permissionForPeer returns the Permission installed for peer on this
+// allocation, or nil if none was.
+func (a *Allocation) permissionForPeer(peer gturn.PeerAddress) *Permission {
+	a.mux.RLock()
+	defer a.mux.RUnlock()
+	for _, p := range a.perms {
+		if gturn.Addr(p.peerAddr).Equal(gturn.Addr(peer)) {
+			return p
+		}
+	}
+	return nil
+}
+
+// permissionForChannel returns the Permission bound to ChannelNumber n
+// on this allocation, or nil if none is.
+func (a *Allocation) permissionForChannel(n gturn.ChannelNumber) *Permission {
+	a.mux.RLock()
+	defer a.mux.RUnlock()
+	for _, p := range a.perms {
+		if p.Binding() == n {
+			return p
+		}
+	}
+	return nil
+}
+
+// Create installs a permission for peer on the allocation and returns a
+// net.Conn that reads and writes data relayed to and from that peer.
+func (a *Allocation) Create(peer gturn.PeerAddress) (net.Conn, error) {
+	req := stun.MustBuild(stun.TransactionID,
+		stun.NewType(stun.MethodCreatePermission, stun.ClassRequest),
+		peer,
+	)
+	if err := a.do(req, nil); err != nil {
+		return nil, err
+	}
+	local, remote := net.Pipe()
+	p := &Permission{
+		peerAddr: peer,
+		peerL:    local,
+	}
+	a.mux.Lock()
+	a.perms = append(a.perms, p)
+	a.mux.Unlock()
+	go a.forwardWrites(p)
+	atomic.AddInt64(&a.client.stats.permsInstalled, 1)
+	a.client.observe("turn_permissions_installed_total", 1)
+	return remote, nil
+}
+
+// forwardWrites relays whatever the caller writes to the net.Conn
+// returned from Create out to p's peer, for as long as peerL is open:
+// a Send indication while p has no channel binding, or the more
+// compact ChannelData framing once Bind has given it one.
+func (a *Allocation) forwardWrites(p *Permission) {
+	buf := make([]byte, relayBufferSize)
+	for {
+		n, err := p.peerL.Read(buf)
+		if err != nil {
+			return
+		}
+		data := append([]byte(nil), buf[:n]...)
+		var sendErr error
+		if n := p.Binding(); n != 0 {
+			_, sendErr = a.client.sendChan(data, n)
+		} else {
+			_, sendErr = a.client.sendData(data, &p.peerAddr)
+		}
+		if sendErr != nil {
+			a.log.Error("failed to forward data to peer", zap.Error(sendErr))
+		}
+	}
+}
+
+// Bind requests a channel binding for peer, letting subsequent traffic
+// to it use the more compact ChannelData framing instead of Send
+// indications. peer must already have an installed permission from
+// Create.
+func (a *Allocation) Bind(n gturn.ChannelNumber, peer gturn.PeerAddress) error {
+	if err := a.do(stun.MustBuild(stun.TransactionID,
+		stun.NewType(stun.MethodChannelBind, stun.ClassRequest),
+		peer, n,
+	), nil); err != nil {
+		return err
+	}
+	a.mux.Lock()
+	for _, p := range a.perms {
+		if gturn.Addr(p.peerAddr).Equal(gturn.Addr(peer)) {
+			p.binding = n
+			break
+		}
+	}
+	a.mux.Unlock()
+	atomic.AddInt64(&a.client.stats.channelsBound, 1)
+	a.client.observe("turn_channels_bound_total", 1)
+	return nil
+}
+
+// SetChannelRate limits the egress rate of ChannelNumber n to
+// bytesPerSec, or removes the limit when bytesPerSec is zero or
+// negative.
+func (a *Allocation) SetChannelRate(n gturn.ChannelNumber, bytesPerSec int64) {
+	a.scheduler().setRate(n, bytesPerSec)
+}
+
+// SetChannelPriority sets the weight ChannelNumber n gets when the
+// egress scheduler drains queued channels; channels with a higher
+// priority are drained first on every flush.
+func (a *Allocation) SetChannelPriority(n gturn.ChannelNumber, priority int) {
+	a.scheduler().setPriority(n, priority)
+}
+
+// SetChannelQueueCapacity overrides defaultSendQueueCapacity for
+// ChannelNumber n: how many pending ChannelData payloads its egress
+// queue can hold before sendChan starts returning ErrChannelQueueFull.
+// Values <= 0 are ignored.
+func (a *Allocation) SetChannelQueueCapacity(n gturn.ChannelNumber, capacity int) {
+	a.scheduler().setCapacity(n, capacity)
+}
+
+// ChannelStats returns the egress counters the scheduler has recorded
+// for ChannelNumber n.
+func (a *Allocation) ChannelStats(n gturn.ChannelNumber) ChannelStats {
+	return a.scheduler().stats(n)
+}
+
+// Close releases the allocation's local resources, including its
+// dedicated transport if it was opened via AllocationDialer. It does not
+// send a Refresh with a zero lifetime; callers that want to tear down
+// the allocation on the server should do that via Client.CloseAllocation.
+func (a *Allocation) Close() error {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	for _, p := range a.perms {
+		_ = p.peerL.Close()
+	}
+	a.perms = nil
+	if a.natGW != nil {
+		if err := a.natGW.DeleteMapping("udp", a.natPort, a.natPort); err != nil {
+			a.log.Warn("failed to delete NAT mapping", zap.Error(err))
+		}
+		a.natGW = nil
+	}
+	if a.tr != nil {
+		a.tr.sched.close()
+		return a.tr.con.Close()
+	}
+	return nil
+}
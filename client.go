@@ -1,16 +1,22 @@
 package turn
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/pion/dtls/v2"
 	"go.uber.org/zap"
 
-	"github.com/gortc/stun"
+	"gortc.io/stun"
+	gturn "gortc.io/turn"
+
+	"github.com/trustkeys/turn/nat"
 )
 
 // Client for TURN server.
@@ -25,8 +31,29 @@ type Client struct {
 	password    string
 	realm       stun.Realm
 	integrity   stun.MessageIntegrity
-	alloc       *Allocation // the only allocation
+	allocs      map[string]*Allocation
 	refreshRate time.Duration
+
+	persistent       bool
+	reconnectBackoff time.Duration
+	reconnectMux     sync.Mutex
+	dialer           func() (net.Conn, error)
+	events           chan Event
+
+	// primary is the allocation, if any, that reuses con/stun/sched
+	// instead of a dedicated transport; only it is reachable from
+	// stunHandler/handleChannelData.
+	primary     *Allocation
+	allocDialer func() (net.Conn, error)
+
+	flushInterval time.Duration
+	sched         *scheduler
+
+	enableNAT bool
+	natGW     nat.Interface
+
+	stats   clientStats
+	metrics MetricsSink
 }
 
 // ClientOptions contains available config for TURN  client.
@@ -46,6 +73,48 @@ type ClientOptions struct {
 	// TURN options.
 	RefreshRate     time.Duration
 	RefreshDisabled bool
+
+	// Transport security, used by Dial to pick the right framing.
+	// Only one of TLSConfig, DTLSConfig should be set.
+	TLSConfig  *tls.Config  // TURNS, TCP+TLS (RFC 5928)
+	DTLSConfig *dtls.Config // TURN-over-DTLS (RFC 7350)
+
+	// Persistent, when set, makes the Client transparently redial and
+	// re-establish its allocations and permissions after the underlying
+	// connection is lost, instead of stopping readUntilClosed.
+	Persistent bool
+	// ReconnectBackoff is the delay between redial attempts. Defaults
+	// to defaultReconnectBackoff.
+	ReconnectBackoff time.Duration
+	// Dialer redials the server. Required when Persistent is set.
+	Dialer func() (net.Conn, error)
+
+	// AllocationDialer opens a fresh connection to the TURN server for
+	// every Allocate call after the first. RFC 5766 Section 6.2 rejects
+	// a second Allocate on an already-allocated five-tuple with 437
+	// (Allocation Mismatch), so holding several allocations on one
+	// Client requires a dedicated connection per allocation past the
+	// first; Allocate returns ErrAllocationDialerRequired if this is
+	// unset and an allocation already exists.
+	AllocationDialer func() (net.Conn, error)
+
+	// FlushInterval controls how often the egress scheduler coalesces
+	// queued ChannelData into a batched write. Defaults to 100ms.
+	FlushInterval time.Duration
+
+	// EnableNATMappings, when set, makes the Client publish a UPnP-IGD
+	// or NAT-PMP mapping for its local UDP port on every Allocate, so
+	// peers can also reach it directly as a server-reflexive fallback.
+	// Discovery and the SOAP/NAT-PMP round trip happen in a background
+	// goroutine started by Allocate, not before it returns, since
+	// first-time gateway discovery alone can take up to several
+	// seconds.
+	EnableNATMappings bool
+
+	// MetricsSink, if set, receives the same counters exposed via
+	// Client.Stats as they are updated, so callers can bridge them to
+	// Prometheus/OpenTelemetry without this package importing either.
+	MetricsSink MetricsSink
 }
 
 // RefreshRate returns current rate of refresh requests.
@@ -53,6 +122,44 @@ func (c *Client) RefreshRate() time.Duration { return c.refreshRate }
 
 const defaultRefreshRate = time.Minute
 
+// defaultReconnectBackoff is used when ClientOptions.ReconnectBackoff
+// is not set on a Persistent Client.
+const defaultReconnectBackoff = 5 * time.Second
+
+const eventBacklog = 16
+
+// EventKind enumerates the kinds of Event a Client can emit.
+type EventKind int
+
+// Event kinds emitted on Client.Events().
+const (
+	EventReconnecting EventKind = iota
+	EventReconnected
+	EventReconnectFailed
+)
+
+// Event describes a state change of a Persistent Client, such as a
+// reconnect attempt starting, succeeding or failing.
+type Event struct {
+	Kind EventKind
+	Err  error
+}
+
+// Events returns the channel Persistent clients emit Events on. It is
+// nil for clients that were not created with ClientOptions.Persistent.
+func (c *Client) Events() <-chan Event { return c.events }
+
+func (c *Client) emit(e Event) {
+	if c.events == nil {
+		return
+	}
+	select {
+	case c.events <- e:
+	default:
+		// Slow consumer: drop rather than block the reconnect loop.
+	}
+}
+
 // NewClient creates and initializes new TURN client.
 func NewClient(o ClientOptions) (*Client, error) {
 	if o.Conn == nil {
@@ -62,21 +169,69 @@ func NewClient(o ClientOptions) (*Client, error) {
 		o.Log = zap.NewNop()
 	}
 	c := &Client{
-		password: o.Password,
-		log:      o.Log,
+		password:      o.Password,
+		log:           o.Log,
+		allocs:        make(map[string]*Allocation),
+		flushInterval: o.FlushInterval,
 	}
-	if o.STUN == nil {
+	if err := c.attach(o.Conn, o); err != nil {
+		return nil, err
+	}
+	c.refreshRate = defaultRefreshRate
+	if o.RefreshRate > 0 {
+		c.refreshRate = o.RefreshRate
+	}
+	if o.RefreshDisabled {
+		c.refreshRate = 0
+	}
+	if o.Username != "" {
+		c.username = stun.NewUsername(o.Username)
+	}
+	c.persistent = o.Persistent
+	c.reconnectBackoff = o.ReconnectBackoff
+	c.dialer = o.Dialer
+	c.allocDialer = o.AllocationDialer
+	c.enableNAT = o.EnableNATMappings
+	c.metrics = o.MetricsSink
+	if c.refreshRate > 0 {
+		go c.refreshLoop()
+	}
+	if c.persistent {
+		c.events = make(chan Event, eventBacklog)
+	}
+	go c.readUntilClosed()
+	return c, nil
+}
+
+// clientTransport bundles the pieces needed to talk to a TURN server
+// over a single connection: the (possibly multiplexed) conn, its STUN
+// client and its egress scheduler. The Client keeps one as its primary
+// transport; every Allocation opened via AllocationDialer keeps its own
+// so it never shares a five-tuple with another allocation.
+type clientTransport struct {
+	con   net.Conn
+	stun  STUNClient
+	sched *scheduler
+}
+
+// newTransport wires conn (and, unless o.STUN is set, a fresh STUN
+// client multiplexed over it) into a clientTransport, delivering Data
+// indications to handler.
+func (c *Client) newTransport(conn net.Conn, o ClientOptions, handler func(stun.Event)) (*clientTransport, error) {
+	stunClient := o.STUN
+	if stunClient == nil {
 		// Setting up de-multiplexing.
-		m := newMultiplexer(o.Conn, c.log.Named("multiplexer"))
+		m := newMultiplexer(conn, c.log.Named("multiplexer"))
 		go m.discardData() // discarding any non-stun/turn data
-		o.Conn = bypassWriter{
+		conn = bypassWriter{
 			reader: m.turnL,
 			writer: m.conn,
 		}
 		// Starting STUN client on multiplexed connection.
 		var err error
 		stunOptions := []stun.ClientOption{
-			stun.WithHandler(c.stunHandler),
+			stun.WithHandler(handler),
+			stun.WithAgent(newRetransmitAgent(stun.NewAgent(nil), c.onRetransmit)),
 		}
 		if o.NoRetransmit {
 			stunOptions = append(stunOptions, stun.WithNoRetransmit)
@@ -84,7 +239,7 @@ func NewClient(o ClientOptions) (*Client, error) {
 		if o.RTO > 0 {
 			stunOptions = append(stunOptions, stun.WithRTO(o.RTO))
 		}
-		o.STUN, err = stun.NewClient(bypassWriter{
+		stunClient, err = stun.NewClient(bypassWriter{
 			reader: m.stunL,
 			writer: m.conn,
 		}, stunOptions...)
@@ -92,20 +247,42 @@ func NewClient(o ClientOptions) (*Client, error) {
 			return nil, err
 		}
 	}
-	c.stun = o.STUN
-	c.con = o.Conn
-	c.refreshRate = defaultRefreshRate
-	if o.RefreshRate > 0 {
-		c.refreshRate = o.RefreshRate
-	}
-	if o.RefreshDisabled {
-		c.refreshRate = 0
+	return &clientTransport{
+		con:   conn,
+		stun:  stunClient,
+		sched: newScheduler(conn, c.flushInterval),
+	}, nil
+}
+
+// attach wires conn into c's primary transport, replacing any previous
+// one. It is used both by NewClient and, for persistent clients, by
+// reconnect; reconnect can run concurrently with any in-flight
+// sendData/sendChan/do on the old transport, so the swap is guarded by
+// c.mux like every other read of con/stun/sched.
+func (c *Client) attach(conn net.Conn, o ClientOptions) error {
+	tr, err := c.newTransport(conn, o, c.stunHandler)
+	if err != nil {
+		return err
 	}
-	if o.Username != "" {
-		c.username = stun.NewUsername(o.Username)
+	c.mux.Lock()
+	old := c.sched
+	c.con = tr.con
+	c.stun = tr.stun
+	c.sched = tr.sched
+	c.mux.Unlock()
+	if old != nil {
+		old.close()
 	}
-	go c.readUntilClosed()
-	return c, nil
+	return nil
+}
+
+// primaryTransport returns a consistent snapshot of the primary
+// transport's con/stun/sched, guarded against a concurrent attach (from
+// reconnect) replacing them mid-send.
+func (c *Client) primaryTransport() (net.Conn, STUNClient, *scheduler) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.con, c.stun, c.sched
 }
 
 // STUNClient abstracts STUN protocol interaction.
@@ -114,6 +291,181 @@ type STUNClient interface {
 	Do(m *stun.Message, f func(e stun.Event)) error
 }
 
+// ErrAllocationDialerRequired is returned by Allocate when the Client
+// already holds an allocation on its primary connection and
+// ClientOptions.AllocationDialer was not configured to open another.
+var ErrAllocationDialerRequired = errors.New("turn: a second concurrent allocation requires ClientOptions.AllocationDialer")
+
+// Allocate requests a new allocation from the TURN server and registers
+// it on the Client. The returned Allocation is independent from any
+// other allocation the Client already holds; a single Client can keep
+// several allocations open concurrently, each on its own connection, as
+// RFC 5766 Section 6.2 requires a distinct five-tuple per allocation.
+// The first Allocate call, and the first after the primary allocation
+// was closed, reuses the Client's primary connection; every other call
+// dials a fresh one via ClientOptions.AllocationDialer.
+func (c *Client) Allocate() (*Allocation, error) {
+	c.mux.RLock()
+	hasPrimary := c.primary != nil
+	c.mux.RUnlock()
+	if !hasPrimary {
+		_, stunClient, _ := c.primaryTransport()
+		a, err := c.allocateOn(stunClient)
+		if err != nil {
+			return nil, err
+		}
+		c.mux.Lock()
+		c.primary = a
+		c.allocs[a.id] = a
+		c.mux.Unlock()
+		if c.enableNAT {
+			con, _, _ := c.primaryTransport()
+			go c.publishNATMapping(con, a)
+		}
+		return a, nil
+	}
+	if c.allocDialer == nil {
+		return nil, ErrAllocationDialerRequired
+	}
+	conn, err := c.allocDialer()
+	if err != nil {
+		return nil, fmt.Errorf("turn: dial allocation transport: %w", err)
+	}
+	var a *Allocation
+	tr, err := c.newTransport(conn, ClientOptions{
+		Username: c.username.String(),
+		Password: c.password,
+	}, func(e stun.Event) {
+		if a != nil {
+			c.allocationStunHandler(a, e)
+		}
+	})
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	a, err = c.allocateOn(tr.stun)
+	if err != nil {
+		tr.sched.close()
+		_ = conn.Close()
+		return nil, err
+	}
+	a.tr = tr
+	c.mux.Lock()
+	c.allocs[a.id] = a
+	c.mux.Unlock()
+	go c.readAllocation(tr, a)
+	if c.enableNAT {
+		go c.publishNATMapping(conn, a)
+	}
+	return a, nil
+}
+
+// allocateOn sends an Allocate request over stunClient and wraps the
+// resulting relayed-transport-address into a new Allocation.
+func (c *Client) allocateOn(stunClient STUNClient) (*Allocation, error) {
+	var relayed gturn.RelayedAddress
+	res := stun.New()
+	req := stun.MustBuild(stun.TransactionID,
+		stun.NewType(stun.MethodAllocate, stun.ClassRequest),
+		gturn.RequestedTransportUDP,
+	)
+	if err := c.doWith(stunClient, req, res); err != nil {
+		return nil, err
+	}
+	if err := res.Parse(&relayed); err != nil {
+		return nil, err
+	}
+	a := newAllocation(c, relayed)
+	a.expiresAt = lifetimeDeadline(res)
+	return a, nil
+}
+
+// natMappingLifetime is how long a published NAT mapping is requested
+// for. Each Allocate maps its own connection's port once; an existing
+// mapping is not renewed.
+const natMappingLifetime = time.Hour
+
+// publishNATMapping discovers a UPnP-IGD or NAT-PMP gateway, caches it
+// on the Client, and maps conn's local UDP port so a peer can also
+// reach a directly as a server-reflexive fallback. It runs in its own
+// goroutine, started by Allocate, because first-time gateway discovery
+// (up to discoverTimeout) plus the blocking SOAP/NAT-PMP call can take
+// several seconds. The mapping it installs is recorded on a so
+// Allocation.Close can tear it down again.
+func (c *Client) publishNATMapping(conn net.Conn, a *Allocation) {
+	udpAddr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		c.log.Debug("skipping NAT mapping: not a UDP connection")
+		return
+	}
+	c.mux.Lock()
+	gw := c.natGW
+	c.mux.Unlock()
+	if gw == nil {
+		var err error
+		gw, err = nat.Any()
+		if err != nil {
+			c.log.Warn("NAT gateway discovery failed", zap.Error(err))
+			return
+		}
+		c.mux.Lock()
+		c.natGW = gw
+		c.mux.Unlock()
+	}
+	if err := gw.AddMapping("udp", udpAddr.Port, udpAddr.Port, "turn-client", natMappingLifetime); err != nil {
+		c.log.Warn("failed to add NAT mapping", zap.Error(err))
+		return
+	}
+	a.mux.Lock()
+	a.natGW = gw
+	a.natPort = udpAddr.Port
+	a.mux.Unlock()
+}
+
+// Allocations returns a snapshot of the allocations currently held by
+// the Client.
+func (c *Client) Allocations() []*Allocation {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	allocs := make([]*Allocation, 0, len(c.allocs))
+	for _, a := range c.allocs {
+		allocs = append(allocs, a)
+	}
+	return allocs
+}
+
+// CloseAllocation deletes the allocation with the given ID on the server
+// with a zero-lifetime Refresh, closes it and removes it from the
+// Client. It returns an error if no such allocation exists.
+func (c *Client) CloseAllocation(id string) error {
+	c.mux.Lock()
+	a, ok := c.allocs[id]
+	if ok {
+		delete(c.allocs, id)
+		if c.primary == a {
+			c.primary = nil
+		}
+	}
+	c.mux.Unlock()
+	if !ok {
+		return fmt.Errorf("no allocation with id %q", id)
+	}
+	refreshErr := a.do(stun.MustBuild(stun.TransactionID,
+		stun.NewType(stun.MethodRefresh, stun.ClassRequest),
+		gturn.Lifetime{},
+	), nil)
+	if err := a.Close(); err != nil {
+		return err
+	}
+	return refreshErr
+}
+
+// stunHandler delivers Data indications arriving on the primary
+// connection to the primary allocation. Allocations opened via
+// AllocationDialer have their own dedicated transport and handler
+// (allocationStunHandler), so there is never more than one candidate
+// allocation to route to here.
 func (c *Client) stunHandler(e stun.Event) {
 	if e.Error != nil {
 		// Just ignoring.
@@ -123,49 +475,74 @@ func (c *Client) stunHandler(e stun.Event) {
 		return
 	}
 	var (
-		data Data
-		addr PeerAddress
+		data gturn.Data
+		addr gturn.PeerAddress
 	)
 	if err := e.Message.Parse(&data, &addr); err != nil {
 		c.log.Error("failed to parse while handling incoming STUN message", zap.Error(err))
 		return
 	}
 	c.mux.RLock()
-	for i := range c.alloc.perms {
-		if !Addr(c.alloc.perms[i].peerAddr).Equal(Addr(addr)) {
-			continue
-		}
-		if _, err := c.alloc.perms[i].peerL.Write(data); err != nil {
-			c.log.Error("failed to write", zap.Error(err))
-		}
-	}
+	a := c.primary
 	c.mux.RUnlock()
+	if a == nil {
+		return
+	}
+	a.handleData(addr, data)
+}
+
+// allocationStunHandler delivers Data indications arriving on a's own
+// dedicated transport directly to a.
+func (c *Client) allocationStunHandler(a *Allocation, e stun.Event) {
+	if e.Error != nil {
+		return
+	}
+	if e.Message.Type != stun.NewType(stun.MethodData, stun.ClassIndication) {
+		return
+	}
+	var (
+		data gturn.Data
+		addr gturn.PeerAddress
+	)
+	if err := e.Message.Parse(&data, &addr); err != nil {
+		c.log.Error("failed to parse while handling incoming STUN message", zap.Error(err))
+		return
+	}
+	a.handleData(addr, data)
 }
 
 // ZapChannelNumber returns zap.Field for ChannelNumber.
-func ZapChannelNumber(key string, v ChannelNumber) zap.Field {
+func ZapChannelNumber(key string, v gturn.ChannelNumber) zap.Field {
 	return zap.String(key, fmt.Sprintf("0x%x", int(v)))
 }
 
-func (c *Client) handleChannelData(data *ChannelData) {
+func (c *Client) handleChannelData(data *gturn.ChannelData) {
 	c.log.Debug("handleChannelData", ZapChannelNumber("number", data.Number))
 	c.mux.RLock()
-	for i := range c.alloc.perms {
-		if data.Number != c.alloc.perms[i].Binding() {
-			continue
-		}
-		if _, err := c.alloc.perms[i].peerL.Write(data.Data); err != nil {
-			c.log.Error("failed to write", zap.Error(err))
-		}
-	}
+	a := c.primary
 	c.mux.RUnlock()
+	if a == nil {
+		return
+	}
+	a.handleChannelData(data)
 }
 
+// readUntilClosed reads ChannelData off the primary connection for as
+// long as the Client is alive, handing each frame to the primary
+// allocation. Allocations opened via AllocationDialer are read by their
+// own readAllocation loop instead. It re-snapshots the primary
+// connection via primaryTransport() on every iteration rather than
+// touching c.con directly, since reconnect replaces it under c.mux.Lock
+// from a concurrent goroutine.
 func (c *Client) readUntilClosed() {
-	buf := make([]byte, 1500)
+	buf := make([]byte, maxFrameSize)
 	for {
-		n, err := c.con.Read(buf)
+		con, _, _ := c.primaryTransport()
+		n, err := con.Read(buf)
 		if err != nil {
+			if c.persistent && c.reconnect(err) {
+				continue
+			}
 			if err == io.EOF {
 				continue
 			}
@@ -173,10 +550,10 @@ func (c *Client) readUntilClosed() {
 			break
 		}
 		data := buf[:n]
-		if !IsChannelData(data) {
+		if !gturn.IsChannelData(data) {
 			continue
 		}
-		cData := &ChannelData{
+		cData := &gturn.ChannelData{
 			Raw: make([]byte, n),
 		}
 		copy(cData.Raw, data)
@@ -187,32 +564,110 @@ func (c *Client) readUntilClosed() {
 	}
 }
 
-func (c *Client) sendData(buf []byte, peerAddr *PeerAddress) (int, error) {
-	err := c.stun.Indicate(stun.MustBuild(stun.TransactionID,
+// readAllocation reads ChannelData off a's dedicated transport for as
+// long as tr is alive, handing each frame directly to a. A Persistent
+// Client redials a's own connection via AllocationDialer and hands off
+// to a fresh readAllocation on success, the same way readUntilClosed
+// does for the primary connection.
+func (c *Client) readAllocation(tr *clientTransport, a *Allocation) {
+	buf := make([]byte, maxFrameSize)
+	for {
+		n, err := tr.con.Read(buf)
+		if err != nil {
+			if c.persistent && c.reconnectAllocation(a, err) {
+				return
+			}
+			if err == io.EOF {
+				continue
+			}
+			c.log.Error("allocation read failed", zap.Error(err), zap.String("allocation", a.id))
+			return
+		}
+		data := buf[:n]
+		if !gturn.IsChannelData(data) {
+			continue
+		}
+		cData := &gturn.ChannelData{
+			Raw: make([]byte, n),
+		}
+		copy(cData.Raw, data)
+		if err := cData.Decode(); err != nil {
+			panic(err)
+		}
+		go a.handleChannelData(cData)
+	}
+}
+
+func (c *Client) sendData(buf []byte, peerAddr *gturn.PeerAddress) (int, error) {
+	_, stunClient, _ := c.primaryTransport()
+	err := stunClient.Indicate(stun.MustBuild(stun.TransactionID,
 		stun.NewType(stun.MethodSend, stun.ClassIndication),
-		Data(buf), peerAddr,
+		gturn.Data(buf), peerAddr,
 	))
-	if err == nil {
-		return len(buf), nil
+	if err != nil {
+		return 0, err
+	}
+	if p := c.permissionForPeer(*peerAddr); p != nil {
+		atomic.AddInt64(&p.bytesSent, int64(len(buf)))
 	}
-	return 0, err
+	atomic.AddInt64(&c.stats.sendBytesSent, int64(len(buf)))
+	atomic.AddInt64(&c.stats.bytesSent, int64(len(buf)))
+	atomic.AddInt64(&c.stats.packetsSent, 1)
+	c.observe("turn_send_bytes_total", float64(len(buf)), "via", "send")
+	return len(buf), nil
 }
 
-func (c *Client) sendChan(buf []byte, n ChannelNumber) (int, error) {
+func (c *Client) sendChan(buf []byte, n gturn.ChannelNumber) (int, error) {
 	if !n.Valid() {
-		return 0, ErrInvalidChannelNumber
+		return 0, gturn.ErrInvalidChannelNumber
 	}
-	d := &ChannelData{
-		Data:   buf,
-		Number: n,
+	_, _, sched := c.primaryTransport()
+	if !sched.send(n, buf) {
+		return 0, ErrChannelQueueFull
 	}
-	d.Encode()
-	return c.con.Write(d.Raw)
+	if p := c.permissionForChannel(n); p != nil {
+		atomic.AddInt64(&p.bytesSent, int64(len(buf)))
+	}
+	atomic.AddInt64(&c.stats.channelBytesSent, int64(len(buf)))
+	atomic.AddInt64(&c.stats.bytesSent, int64(len(buf)))
+	atomic.AddInt64(&c.stats.packetsSent, 1)
+	c.observe("turn_send_bytes_total", float64(len(buf)), "via", "channel")
+	return len(buf), nil
+}
+
+// permissionForPeer finds the Permission installed for peer across
+// every allocation the Client holds.
+func (c *Client) permissionForPeer(peer gturn.PeerAddress) *Permission {
+	for _, a := range c.Allocations() {
+		if p := a.permissionForPeer(peer); p != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+// permissionForChannel finds the Permission bound to ChannelNumber n
+// across every allocation the Client holds.
+func (c *Client) permissionForChannel(n gturn.ChannelNumber) *Permission {
+	for _, a := range c.Allocations() {
+		if p := a.permissionForChannel(n); p != nil {
+			return p
+		}
+	}
+	return nil
 }
 
 func (c *Client) do(req, res *stun.Message) error {
+	_, stunClient, _ := c.primaryTransport()
+	return c.doWith(stunClient, req, res)
+}
+
+// doWith is like do but sends req over an explicit STUN client, so an
+// Allocation with its own dedicated transport can send requests on it
+// instead of the Client's primary one.
+func (c *Client) doWith(stunClient STUNClient, req, res *stun.Message) error {
 	var stunErr error
-	if doErr := c.stun.Do(req, func(e stun.Event) {
+	if doErr := stunClient.Do(req, func(e stun.Event) {
 		if e.Error != nil {
 			stunErr = e.Error
 			return
@@ -228,3 +683,238 @@ func (c *Client) do(req, res *stun.Message) error {
 	}
 	return stunErr
 }
+
+// reconnect redials the server and re-establishes every allocation the
+// Client held, retrying with ReconnectBackoff until it succeeds or the
+// Client has no Dialer configured. It reports progress on Events() and
+// returns whether the caller should keep reading from c.con.
+func (c *Client) reconnect(cause error) bool {
+	if c.dialer == nil {
+		return false
+	}
+	// Both readUntilClosed and the refresh loop can observe the primary
+	// connection failing and call in concurrently; serialize so they
+	// don't redial and re-attach over each other.
+	c.reconnectMux.Lock()
+	defer c.reconnectMux.Unlock()
+	backoff := c.reconnectBackoff
+	if backoff <= 0 {
+		backoff = defaultReconnectBackoff
+	}
+	c.emit(Event{Kind: EventReconnecting, Err: cause})
+	for {
+		conn, err := c.dialer()
+		if err != nil {
+			c.log.Error("redial failed", zap.Error(err))
+			c.emit(Event{Kind: EventReconnectFailed, Err: err})
+			time.Sleep(backoff)
+			continue
+		}
+		if err := c.attach(conn, ClientOptions{
+			Username: c.username.String(),
+			Password: c.password,
+		}); err != nil {
+			c.log.Error("failed to re-attach transport", zap.Error(err))
+			c.emit(Event{Kind: EventReconnectFailed, Err: err})
+			time.Sleep(backoff)
+			continue
+		}
+		if err := c.reestablish(); err != nil {
+			c.log.Error("failed to restore allocations", zap.Error(err))
+			c.emit(Event{Kind: EventReconnectFailed, Err: err})
+			time.Sleep(backoff)
+			continue
+		}
+		c.emit(Event{Kind: EventReconnected})
+		return true
+	}
+}
+
+// reestablish redoes Allocate, CreatePermission and ChannelBind for the
+// primary allocation and its permissions after a reconnect, so the
+// net.Conns previously returned from Allocation.Create keep working
+// without the caller noticing the underlying redial. Allocations opened
+// via AllocationDialer live on their own connection and are unaffected
+// by a primary-connection reconnect; reconnectAllocation is their
+// equivalent.
+func (c *Client) reestablish() error {
+	c.mux.RLock()
+	a := c.primary
+	c.mux.RUnlock()
+	if a == nil {
+		return nil
+	}
+	if err := c.reallocate(a); err != nil {
+		return fmt.Errorf("allocation %s: %w", a.id, err)
+	}
+	return nil
+}
+
+// reconnectAllocation redials a's dedicated connection via
+// AllocationDialer and redoes Allocate, CreatePermission and
+// ChannelBind for it, retrying with ReconnectBackoff until it succeeds
+// or the Client has no AllocationDialer configured. It is
+// reconnect/reestablish's equivalent for an allocation opened via
+// AllocationDialer, whose connection a primary-connection reconnect
+// never touches. It returns whether the caller should keep reading from
+// the allocation's (possibly now-replaced) transport.
+func (c *Client) reconnectAllocation(a *Allocation, cause error) bool {
+	if c.allocDialer == nil {
+		return false
+	}
+	// Serialize per allocation: readAllocation and the refresh loop can
+	// both observe this allocation's connection failing and call in
+	// concurrently.
+	a.reconnectMux.Lock()
+	defer a.reconnectMux.Unlock()
+	backoff := c.reconnectBackoff
+	if backoff <= 0 {
+		backoff = defaultReconnectBackoff
+	}
+	c.emit(Event{Kind: EventReconnecting, Err: cause})
+	for {
+		conn, err := c.allocDialer()
+		if err != nil {
+			c.log.Error("allocation redial failed", zap.Error(err), zap.String("allocation", a.id))
+			c.emit(Event{Kind: EventReconnectFailed, Err: err})
+			time.Sleep(backoff)
+			continue
+		}
+		tr, err := c.newTransport(conn, ClientOptions{
+			Username: c.username.String(),
+			Password: c.password,
+		}, func(e stun.Event) { c.allocationStunHandler(a, e) })
+		if err != nil {
+			c.log.Error("failed to re-attach allocation transport", zap.Error(err), zap.String("allocation", a.id))
+			_ = conn.Close()
+			c.emit(Event{Kind: EventReconnectFailed, Err: err})
+			time.Sleep(backoff)
+			continue
+		}
+		a.mux.Lock()
+		old := a.tr
+		a.tr = tr
+		a.mux.Unlock()
+		if err := c.reallocate(a); err != nil {
+			c.log.Error("failed to restore allocation", zap.Error(err), zap.String("allocation", a.id))
+			tr.sched.close()
+			_ = conn.Close()
+			c.emit(Event{Kind: EventReconnectFailed, Err: err})
+			time.Sleep(backoff)
+			continue
+		}
+		if old != nil {
+			old.sched.close()
+			_ = old.con.Close()
+		}
+		go c.readAllocation(tr, a)
+		c.emit(Event{Kind: EventReconnected})
+		return true
+	}
+}
+
+// reallocate redoes Allocate, CreatePermission and ChannelBind for a and
+// its permissions, sending every request over a's own STUN client
+// (a.do) so it works the same whether a is the primary allocation or
+// one opened via AllocationDialer with its own dedicated transport.
+func (c *Client) reallocate(a *Allocation) error {
+	var relayed gturn.RelayedAddress
+	res := stun.New()
+	req := stun.MustBuild(stun.TransactionID,
+		stun.NewType(stun.MethodAllocate, stun.ClassRequest),
+		gturn.RequestedTransportUDP,
+	)
+	if err := a.do(req, res); err != nil {
+		return err
+	}
+	if err := res.Parse(&relayed); err != nil {
+		return err
+	}
+	a.mux.Lock()
+	a.relayed = relayed
+	a.expiresAt = lifetimeDeadline(res)
+	perms := make([]*Permission, len(a.perms))
+	copy(perms, a.perms)
+	a.mux.Unlock()
+	for _, p := range perms {
+		if err := a.do(stun.MustBuild(stun.TransactionID,
+			stun.NewType(stun.MethodCreatePermission, stun.ClassRequest),
+			p.peerAddr,
+		), nil); err != nil {
+			return err
+		}
+		if p.Binding() == 0 {
+			continue
+		}
+		if err := a.do(stun.MustBuild(stun.TransactionID,
+			stun.NewType(stun.MethodChannelBind, stun.ClassRequest),
+			p.peerAddr, p.Binding(),
+		), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lifetimeDeadline turns the Lifetime attribute of a response into an
+// absolute deadline, or the zero Time if the server didn't return one.
+func lifetimeDeadline(res *stun.Message) time.Time {
+	var lifetime gturn.Lifetime
+	if err := res.Parse(&lifetime); err != nil {
+		return time.Time{}
+	}
+	return time.Now().Add(lifetime.Duration)
+}
+
+// refreshLoop sends a Refresh request for every allocation the Client
+// holds every RefreshRate, keeping them alive on the server. A failed
+// refresh on the primary allocation usually means the connection itself
+// is gone (437 Allocation Mismatch, or the request simply timing out),
+// so a Persistent Client redials the same way it would after
+// readUntilClosed observes the failure.
+func (c *Client) refreshLoop() {
+	ticker := time.NewTicker(c.refreshRate)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.mux.RLock()
+		primary := c.primary
+		c.mux.RUnlock()
+		for _, a := range c.Allocations() {
+			if err := c.refresh(a); err != nil {
+				atomic.AddInt64(&c.stats.refreshFail, 1)
+				c.observe("turn_refresh_total", 1, "result", "failure")
+				c.log.Error("refresh failed", zap.Error(err))
+				if c.persistent {
+					// Reconnecting redials and retries with backoff
+					// until it succeeds, so it must not run on this
+					// goroutine: every other allocation's refresh for
+					// this tick would stall behind it for as long as
+					// the outage lasts.
+					if a == primary {
+						go c.reconnect(err)
+					} else {
+						go c.reconnectAllocation(a, err)
+					}
+				}
+				continue
+			}
+			atomic.AddInt64(&c.stats.refreshOK, 1)
+			c.observe("turn_refresh_total", 1, "result", "success")
+		}
+	}
+}
+
+func (c *Client) refresh(a *Allocation) error {
+	lifetime := gturn.Lifetime{Duration: c.refreshRate * 2}
+	res := stun.New()
+	if err := a.do(stun.MustBuild(stun.TransactionID,
+		stun.NewType(stun.MethodRefresh, stun.ClassRequest),
+		lifetime,
+	), res); err != nil {
+		return err
+	}
+	a.mux.Lock()
+	a.expiresAt = lifetimeDeadline(res)
+	a.mux.Unlock()
+	return nil
+}
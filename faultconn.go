@@ -0,0 +1,219 @@
+package turn
+
+import (
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// FaultMode selects which classes of fault FaultyConn injects.
+type FaultMode int
+
+// Fault modes supported by FaultyConn.
+const (
+	FaultOff      FaultMode = iota // no faults except CloseAfter
+	FaultDropOnly                  // only drops reads/writes
+	FaultDelayOnly                 // only delays reads/writes
+	FaultAll                       // drops, delays, reorders, duplicates, corrupts
+)
+
+// DelayDistribution picks how FaultyConn spreads an injected delay
+// between DelayMin and DelayMax.
+type DelayDistribution int
+
+// Delay distributions supported by FaultConfig.
+const (
+	DelayUniform DelayDistribution = iota
+	DelayExponential
+)
+
+// FaultConfig configures the faults FaultyConn injects into a net.Conn.
+// Every probability is independent and in [0, 1]; zero disables that
+// fault regardless of Mode.
+type FaultConfig struct {
+	Mode FaultMode
+
+	DropReadProbability  float64
+	DropWriteProbability float64
+
+	DelayProbability  float64
+	DelayDistribution DelayDistribution
+	DelayMin          time.Duration
+	DelayMax          time.Duration
+
+	ReorderProbability float64
+	ReorderWindow      int // packets buffered before one is flushed
+
+	DuplicateProbability float64
+	CorruptProbability   float64
+
+	// CloseAfter closes the underlying conn once this many combined
+	// read+write operations have been attempted. Zero disables it. It
+	// applies in every Mode, FaultOff included, and counts operations
+	// from the moment the conn is wrapped, regardless of StartDelay.
+	CloseAfter int
+
+	// StartDelay holds off every fault except CloseAfter for this long
+	// after the conn is wrapped, so tests can bring an allocation up
+	// cleanly before enabling chaos.
+	StartDelay time.Duration
+
+	// Rand, if set, is used instead of a process-seeded source. Useful
+	// for deterministic tests.
+	Rand *rand.Rand
+}
+
+// FaultyConn wraps conn so reads and writes are subject to the faults
+// described by cfg: dropped packets, delay, reordering, duplication and
+// corruption. It is meant to exercise the STUN retransmission and
+// reconnect logic without a real lossy network.
+func FaultyConn(conn net.Conn, cfg FaultConfig) net.Conn {
+	if cfg.Rand == nil {
+		cfg.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return &faultyConn{Conn: conn, cfg: cfg, rnd: cfg.Rand, start: time.Now()}
+}
+
+type faultyConn struct {
+	net.Conn
+	cfg   FaultConfig
+	start time.Time
+
+	// mux guards both ops and every use of rnd: *rand.Rand is not safe
+	// for concurrent use, so a second lock around held would not
+	// actually keep Read/Write goroutines from racing on the shared
+	// generator.
+	mux sync.Mutex
+	rnd *rand.Rand
+	ops int
+
+	held [][]byte
+}
+
+func (f *faultyConn) Read(p []byte) (int, error) {
+	if err := f.countOp(); err != nil {
+		return 0, err
+	}
+	n, err := f.Conn.Read(p)
+	if err != nil || !f.active() {
+		return n, err
+	}
+	if f.dropEnabled() && f.chance(f.cfg.DropReadProbability) {
+		return f.Read(p)
+	}
+	f.maybeDelay()
+	return n, err
+}
+
+func (f *faultyConn) Write(p []byte) (int, error) {
+	if err := f.countOp(); err != nil {
+		return 0, err
+	}
+	if !f.active() {
+		return f.Conn.Write(p)
+	}
+	if f.dropEnabled() && f.chance(f.cfg.DropWriteProbability) {
+		return len(p), nil // swallowed, as if lost on an unreliable link
+	}
+	buf := append([]byte(nil), p...)
+	if f.cfg.Mode == FaultAll && len(buf) > 0 && f.chance(f.cfg.CorruptProbability) {
+		buf[f.rnd.Intn(len(buf))] ^= 0xFF
+	}
+	f.maybeDelay()
+	if f.cfg.Mode == FaultAll && f.chance(f.cfg.DuplicateProbability) {
+		if _, err := f.Conn.Write(buf); err != nil {
+			return 0, err
+		}
+	}
+	if f.cfg.Mode == FaultAll && f.cfg.ReorderWindow > 0 && f.chance(f.cfg.ReorderProbability) {
+		return f.holdForReorder(buf)
+	}
+	if _, err := f.Conn.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// holdForReorder buffers buf and, once more than ReorderWindow packets
+// are held, flushes a random one of them out of order.
+func (f *faultyConn) holdForReorder(buf []byte) (int, error) {
+	f.mux.Lock()
+	f.held = append(f.held, buf)
+	var flush []byte
+	if len(f.held) > f.cfg.ReorderWindow {
+		idx := f.rnd.Intn(len(f.held))
+		flush = f.held[idx]
+		f.held = append(f.held[:idx], f.held[idx+1:]...)
+	}
+	f.mux.Unlock()
+	if flush == nil {
+		return len(buf), nil
+	}
+	if _, err := f.Conn.Write(flush); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+func (f *faultyConn) countOp() error {
+	if f.cfg.CloseAfter <= 0 {
+		return nil
+	}
+	f.mux.Lock()
+	f.ops++
+	exceeded := f.ops > f.cfg.CloseAfter
+	f.mux.Unlock()
+	if exceeded {
+		_ = f.Conn.Close()
+		return io.ErrClosedPipe
+	}
+	return nil
+}
+
+func (f *faultyConn) maybeDelay() {
+	if !f.delayEnabled() || !f.chance(f.cfg.DelayProbability) {
+		return
+	}
+	lo, hi := f.cfg.DelayMin, f.cfg.DelayMax
+	if hi <= lo {
+		return
+	}
+	span := hi - lo
+	var d time.Duration
+	f.mux.Lock()
+	switch f.cfg.DelayDistribution {
+	case DelayExponential:
+		d = lo + time.Duration(float64(span)*f.rnd.ExpFloat64()/3)
+	default:
+		d = lo + time.Duration(f.rnd.Int63n(int64(span)))
+	}
+	f.mux.Unlock()
+	if d > hi {
+		d = hi
+	}
+	time.Sleep(d)
+}
+
+func (f *faultyConn) active() bool {
+	return f.cfg.Mode != FaultOff && time.Since(f.start) >= f.cfg.StartDelay
+}
+
+func (f *faultyConn) dropEnabled() bool {
+	return f.cfg.Mode == FaultDropOnly || f.cfg.Mode == FaultAll
+}
+
+func (f *faultyConn) delayEnabled() bool {
+	return f.cfg.Mode == FaultDelayOnly || f.cfg.Mode == FaultAll
+}
+
+func (f *faultyConn) chance(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	f.mux.Lock()
+	v := f.rnd.Float64()
+	f.mux.Unlock()
+	return v < p
+}
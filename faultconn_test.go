@@ -0,0 +1,94 @@
+package turn
+
+import (
+	"io"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestFaultyConnOffPassesThrough(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := FaultyConn(client, FaultConfig{Mode: FaultOff})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 5)
+		n, err := server.Read(buf)
+		if err != nil || string(buf[:n]) != "hello" {
+			t.Errorf("server.Read() = %q, %v, want \"hello\", nil", buf[:n], err)
+		}
+	}()
+
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	<-done
+}
+
+func TestFaultyConnDropWriteSwallowsSilently(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	conn := FaultyConn(client, FaultConfig{
+		Mode:                 FaultDropOnly,
+		DropWriteProbability: 1,
+		Rand:                 rand.New(rand.NewSource(1)),
+	})
+
+	n, err := conn.Write([]byte("hello"))
+	if err != nil || n != 5 {
+		t.Fatalf("Write() = %d, %v, want 5, nil", n, err)
+	}
+
+	server.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err := server.Read(make([]byte, 5)); err == nil {
+		t.Fatal("server.Read() succeeded, want the write to have been dropped")
+	}
+}
+
+func TestFaultyConnCloseAfterClosesUnderlyingConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := FaultyConn(client, FaultConfig{Mode: FaultOff, CloseAfter: 2})
+
+	go server.Read(make([]byte, 1))
+	if _, err := conn.Write([]byte("a")); err != nil {
+		t.Fatalf("first Write: %v", err)
+	}
+	go server.Read(make([]byte, 1))
+	if _, err := conn.Write([]byte("a")); err != nil {
+		t.Fatalf("second Write: %v", err)
+	}
+	if _, err := conn.Write([]byte("a")); err != io.ErrClosedPipe {
+		t.Fatalf("third Write err = %v, want io.ErrClosedPipe", err)
+	}
+}
+
+func TestFaultyConnStartDelayHoldsOffFaults(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	conn := FaultyConn(client, FaultConfig{
+		Mode:                 FaultDropOnly,
+		DropWriteProbability: 1,
+		StartDelay:           time.Hour,
+		Rand:                 rand.New(rand.NewSource(1)),
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 5)
+		if n, err := server.Read(buf); err != nil || string(buf[:n]) != "hello" {
+			t.Errorf("server.Read() = %q, %v, want \"hello\", nil", buf[:n], err)
+		}
+	}()
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	<-done
+}
@@ -0,0 +1,92 @@
+package turn
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gortc.io/stun"
+	gturn "gortc.io/turn"
+)
+
+// multiplexer demultiplexes a single net.Conn carrying both STUN
+// messages and ChannelData datagrams into two separate readers: stunL
+// for the STUN client, turnL for readUntilClosed/readAllocation. A
+// frame that is neither is discarded, since the Client has no other use
+// for it.
+type multiplexer struct {
+	conn net.Conn
+	log  *zap.Logger
+
+	stunL io.Reader
+	turnL io.Reader
+
+	stunW *io.PipeWriter
+	turnW *io.PipeWriter
+}
+
+func newMultiplexer(conn net.Conn, log *zap.Logger) *multiplexer {
+	stunR, stunW := io.Pipe()
+	turnR, turnW := io.Pipe()
+	return &multiplexer{
+		conn:  conn,
+		log:   log,
+		stunL: stunR,
+		turnL: turnR,
+		stunW: stunW,
+		turnW: turnW,
+	}
+}
+
+// discardData reads frames off conn until it errors, forwarding STUN
+// messages to stunL and ChannelData datagrams to turnL; anything that
+// is neither is discarded. It closes both pipes with the read error
+// once conn is gone, so readers blocked on stunL/turnL unblock instead
+// of hanging forever.
+func (m *multiplexer) discardData() {
+	buf := make([]byte, maxFrameSize)
+	for {
+		n, err := m.conn.Read(buf)
+		if err != nil {
+			m.stunW.CloseWithError(err)
+			m.turnW.CloseWithError(err)
+			return
+		}
+		data := buf[:n]
+		switch {
+		case gturn.IsChannelData(data):
+			if _, werr := m.turnW.Write(data); werr != nil {
+				m.log.Error("failed to demux channel data", zap.Error(werr))
+			}
+		case stun.IsMessage(data):
+			if _, werr := m.stunW.Write(data); werr != nil {
+				m.log.Error("failed to demux stun message", zap.Error(werr))
+			}
+		default:
+			m.log.Debug("discarding non-stun/turn data", zap.Int("bytes", n))
+		}
+	}
+}
+
+// bypassWriter pairs a demultiplexed reader with a writer that bypasses
+// the demultiplexer entirely: reads come from reader (one of
+// multiplexer's pipes), writes and everything else (Close, addressing,
+// deadlines) go straight to writer, the real underlying net.Conn, since
+// outbound STUN/ChannelData traffic never needs demuxing.
+type bypassWriter struct {
+	reader io.Reader
+	writer net.Conn
+}
+
+func (b bypassWriter) Read(p []byte) (int, error)        { return b.reader.Read(p) }
+func (b bypassWriter) Write(p []byte) (int, error)       { return b.writer.Write(p) }
+func (b bypassWriter) Close() error                      { return b.writer.Close() }
+func (b bypassWriter) LocalAddr() net.Addr               { return b.writer.LocalAddr() }
+func (b bypassWriter) RemoteAddr() net.Addr              { return b.writer.RemoteAddr() }
+func (b bypassWriter) SetDeadline(t time.Time) error     { return b.writer.SetDeadline(t) }
+func (b bypassWriter) SetReadDeadline(t time.Time) error { return b.writer.SetReadDeadline(t) }
+func (b bypassWriter) SetWriteDeadline(t time.Time) error {
+	return b.writer.SetWriteDeadline(t)
+}
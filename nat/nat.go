@@ -0,0 +1,69 @@
+// Package nat discovers and manipulates port mappings on a NAT gateway,
+// via UPnP-IGD or NAT-PMP/PCP, so a TURN client behind a home router can
+// also expose a server-reflexive mapping for its local candidate.
+//
+// The interfaces here mirror tendermint's p2p/upnp and go-ethereum's
+// p2p/nat packages.
+package nat
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// ErrNoGateway is returned by Any when no usable gateway could be found.
+// DiscoverUPnP and DiscoverNATPMP return it in some of those cases and
+// otherwise return the error that stopped discovery.
+var ErrNoGateway = errors.New("nat: no gateway found")
+
+// Interface is implemented by every supported NAT traversal protocol.
+type Interface interface {
+	// ExternalIP returns the gateway's external IP address.
+	ExternalIP() (net.IP, error)
+	// AddMapping maps extPort on the gateway's external IP to intPort
+	// on the local host for proto ("udp" or "tcp"), valid for lifetime.
+	// name is a human-readable label some protocols (UPnP) store with
+	// the mapping.
+	AddMapping(proto string, extPort, intPort int, name string, lifetime time.Duration) error
+	// DeleteMapping removes a mapping previously installed with
+	// AddMapping.
+	DeleteMapping(proto string, extPort, intPort int) error
+	// String identifies which protocol this Interface uses.
+	String() string
+}
+
+// Any tries every supported protocol concurrently and returns the
+// first Interface that successfully discovers a gateway.
+func Any() (Interface, error) {
+	found := make(chan Interface, 2)
+	go func() {
+		if gw, err := DiscoverUPnP(discoverTimeout); err == nil {
+			found <- gw
+		} else {
+			found <- nil
+		}
+	}()
+	go func() {
+		if gw, err := DiscoverNATPMP(discoverTimeout); err == nil {
+			found <- gw
+		} else {
+			found <- nil
+		}
+	}()
+
+	deadline := time.After(discoverTimeout)
+	for i := 0; i < 2; i++ {
+		select {
+		case gw := <-found:
+			if gw != nil {
+				return gw, nil
+			}
+		case <-deadline:
+			return nil, ErrNoGateway
+		}
+	}
+	return nil, ErrNoGateway
+}
+
+const discoverTimeout = 3 * time.Second
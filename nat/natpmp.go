@@ -0,0 +1,152 @@
+package nat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	natPMPPort           = 5351
+	natPMPVersion        = 0
+	opExternalAddress    = 0
+	opMapUDP             = 1
+	opMapTCP             = 2
+	natPMPResultOK       = 0
+	natPMPRequestTimeout = 250 * time.Millisecond
+	natPMPMaxAttempts    = 4
+)
+
+// natPMPGateway implements Interface over NAT-PMP (RFC 6886). PCP
+// gateways answer the same requests on the same port, so this client
+// works against either.
+type natPMPGateway struct {
+	gateway net.IP
+}
+
+// DiscoverNATPMP finds the default gateway and confirms it speaks
+// NAT-PMP by requesting its external address, within timeout.
+func DiscoverNATPMP(timeout time.Duration) (Interface, error) {
+	gw, err := defaultGateway()
+	if err != nil {
+		return nil, err
+	}
+	g := &natPMPGateway{gateway: gw}
+	done := make(chan error, 1)
+	go func() {
+		_, err := g.ExternalIP()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+	case <-time.After(timeout):
+		return nil, ErrNoGateway
+	}
+	return g, nil
+}
+
+func (g *natPMPGateway) String() string { return "NAT-PMP(" + g.gateway.String() + ")" }
+
+func (g *natPMPGateway) ExternalIP() (net.IP, error) {
+	req := []byte{natPMPVersion, opExternalAddress}
+	res, err := g.call(req, 12)
+	if err != nil {
+		return nil, err
+	}
+	if res[1] != opExternalAddress|0x80 || res[3] != natPMPResultOK {
+		return nil, fmt.Errorf("nat: NAT-PMP external address request failed, result=%d", res[3])
+	}
+	return net.IPv4(res[8], res[9], res[10], res[11]), nil
+}
+
+func (g *natPMPGateway) AddMapping(proto string, extPort, intPort int, name string, lifetime time.Duration) error {
+	op := byte(opMapUDP)
+	if proto == "tcp" {
+		op = opMapTCP
+	}
+	req := make([]byte, 12)
+	req[0] = natPMPVersion
+	req[1] = op
+	binary.BigEndian.PutUint16(req[4:6], uint16(intPort))
+	binary.BigEndian.PutUint16(req[6:8], uint16(extPort))
+	binary.BigEndian.PutUint32(req[8:12], uint32(lifetime.Seconds()))
+
+	res, err := g.call(req, 16)
+	if err != nil {
+		return err
+	}
+	if res[1] != op|0x80 || res[3] != natPMPResultOK {
+		return fmt.Errorf("nat: NAT-PMP mapping request failed, result=%d", res[3])
+	}
+	return nil
+}
+
+func (g *natPMPGateway) DeleteMapping(proto string, extPort, intPort int) error {
+	// RFC 6886 deletes a mapping by requesting it again with a zero
+	// lifetime and external port.
+	op := byte(opMapUDP)
+	if proto == "tcp" {
+		op = opMapTCP
+	}
+	req := make([]byte, 12)
+	req[0] = natPMPVersion
+	req[1] = op
+	binary.BigEndian.PutUint16(req[4:6], uint16(intPort))
+	_, err := g.call(req, 16)
+	return err
+}
+
+// call sends req to the gateway's NAT-PMP port and returns the first
+// wantLen-byte response, retrying with exponential backoff per RFC
+// 6886 section 3.1.
+func (g *natPMPGateway) call(req []byte, wantLen int) ([]byte, error) {
+	conn, err := net.Dial("udp", fmt.Sprintf("%s:%d", g.gateway, natPMPPort))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	timeout := natPMPRequestTimeout
+	buf := make([]byte, 16)
+	var lastErr error
+	for i := 0; i < natPMPMaxAttempts; i++ {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+			return nil, err
+		}
+		n, err := conn.Read(buf)
+		if err == nil && n >= wantLen {
+			return buf[:n], nil
+		}
+		lastErr = err
+		timeout *= 2
+	}
+	if lastErr == nil {
+		lastErr = ErrNoGateway
+	}
+	return nil, lastErr
+}
+
+// defaultGateway guesses the LAN gateway as the ".1" address on the
+// interface the OS would use to reach the internet. Good enough for
+// the common home-router case NAT-PMP targets; on networks where that
+// doesn't hold, DiscoverNATPMP queries the wrong address and finds no
+// gateway.
+func defaultGateway() (net.IP, error) {
+	conn, err := net.Dial("udp4", "203.0.113.1:7")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	local := conn.LocalAddr().(*net.UDPAddr).IP.To4()
+	if local == nil {
+		return nil, ErrNoGateway
+	}
+	return net.IPv4(local[0], local[1], local[2], 1), nil
+}
@@ -0,0 +1,261 @@
+package nat
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const ssdpSearchTarget = "urn:schemas-upnp-org:device:InternetGatewayDevice:1"
+
+// upnpDevice is a UPnP Internet Gateway Device (IGDv1/IGDv2), reached
+// through its WANIPConnection (or WANPPPConnection) control URL.
+type upnpDevice struct {
+	controlURL  string
+	serviceType string
+}
+
+// DiscoverUPnP looks for an InternetGatewayDevice on the local network
+// via SSDP, within timeout, and returns an Interface talking to its
+// WANIPConnection/WANPPPConnection service.
+func DiscoverUPnP(timeout time.Duration) (Interface, error) {
+	loc, err := ssdpDiscover(timeout)
+	if err != nil {
+		return nil, err
+	}
+	dev, err := fetchDevice(loc)
+	if err != nil {
+		return nil, err
+	}
+	return dev, nil
+}
+
+// ssdpDiscover broadcasts an M-SEARCH and returns the LOCATION header
+// of the first InternetGatewayDevice that answers.
+func ssdpDiscover(timeout time.Duration) (string, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	dst, err := net.ResolveUDPAddr("udp4", "239.255.255.250:1900")
+	if err != nil {
+		return "", err
+	}
+	req := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: " + ssdpSearchTarget + "\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(req), dst); err != nil {
+		return "", err
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return "", err
+	}
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return "", ErrNoGateway
+		}
+		loc := headerValue(buf[:n], "LOCATION")
+		if loc != "" {
+			return loc, nil
+		}
+	}
+}
+
+func headerValue(resp []byte, key string) string {
+	for _, line := range strings.Split(string(resp), "\r\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(parts[0]), key) {
+			return strings.TrimSpace(parts[1])
+		}
+	}
+	return ""
+}
+
+// deviceDesc is the subset of a UPnP device description document we
+// need to locate the WANIPConnection/WANPPPConnection control URL.
+type deviceDesc struct {
+	Device struct {
+		DeviceList struct {
+			Device []struct {
+				DeviceList struct {
+					Device []struct {
+						ServiceList struct {
+							Service []upnpService `xml:"service"`
+						} `xml:"serviceList"`
+					} `xml:"device"`
+				} `xml:"deviceList"`
+			} `xml:"device"`
+		} `xml:"deviceList"`
+	} `xml:"device"`
+}
+
+type upnpService struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+func fetchDevice(location string) (*upnpDevice, error) {
+	resp, err := http.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var desc deviceDesc
+	if err := xml.NewDecoder(resp.Body).Decode(&desc); err != nil {
+		return nil, err
+	}
+	for _, wan := range desc.Device.DeviceList.Device {
+		for _, conn := range wan.DeviceList.Device {
+			for _, svc := range conn.ServiceList.Service {
+				if strings.Contains(svc.ServiceType, "WANIPConnection") ||
+					strings.Contains(svc.ServiceType, "WANPPPConnection") {
+					return &upnpDevice{
+						controlURL:  resolveURL(location, svc.ControlURL),
+						serviceType: svc.ServiceType,
+					}, nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("nat: no WANIPConnection service in %s", location)
+}
+
+func resolveURL(base, ref string) string {
+	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+		return ref
+	}
+	idx := strings.Index(base[len("http://"):], "/")
+	if idx < 0 {
+		return base + ref
+	}
+	host := base[:len("http://")+idx]
+	if !strings.HasPrefix(ref, "/") {
+		return host + "/" + ref
+	}
+	return host + ref
+}
+
+func (d *upnpDevice) String() string { return "UPnP-IGD(" + d.serviceType + ")" }
+
+func (d *upnpDevice) ExternalIP() (net.IP, error) {
+	res, err := d.soapCall("GetExternalIPAddress", nil)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(strings.TrimSpace(res["NewExternalIPAddress"]))
+	if ip == nil {
+		return nil, fmt.Errorf("nat: gateway returned no external IP")
+	}
+	return ip, nil
+}
+
+func (d *upnpDevice) AddMapping(proto string, extPort, intPort int, name string, lifetime time.Duration) error {
+	localIP, err := localAddrFor(d.controlURL)
+	if err != nil {
+		return err
+	}
+	_, err = d.soapCall("AddPortMapping", map[string]string{
+		"NewRemoteHost":             "",
+		"NewExternalPort":           fmt.Sprintf("%d", extPort),
+		"NewProtocol":               strings.ToUpper(proto),
+		"NewInternalPort":           fmt.Sprintf("%d", intPort),
+		"NewInternalClient":         localIP,
+		"NewEnabled":                "1",
+		"NewPortMappingDescription": name,
+		"NewLeaseDuration":          fmt.Sprintf("%d", int(lifetime.Seconds())),
+	})
+	return err
+}
+
+func (d *upnpDevice) DeleteMapping(proto string, extPort, intPort int) error {
+	_, err := d.soapCall("DeletePortMapping", map[string]string{
+		"NewRemoteHost":   "",
+		"NewExternalPort": fmt.Sprintf("%d", extPort),
+		"NewProtocol":     strings.ToUpper(proto),
+	})
+	return err
+}
+
+// soapCall invokes action on the gateway's control URL and returns the
+// response's top-level string arguments.
+func (d *upnpDevice) soapCall(action string, args map[string]string) (map[string]string, error) {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0"?>`)
+	body.WriteString(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	fmt.Fprintf(&body, `<u:%s xmlns:u="%s">`, action, d.serviceType)
+	for k, v := range args {
+		fmt.Fprintf(&body, "<%s>%s</%s>", k, v, k)
+	}
+	fmt.Fprintf(&body, `</u:%s></s:Body></s:Envelope>`, action)
+
+	req, err := http.NewRequest(http.MethodPost, d.controlURL, bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", fmt.Sprintf(`"%s#%s"`, d.serviceType, action))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("nat: gateway rejected %s: %s", action, resp.Status)
+	}
+
+	var env struct {
+		Body struct {
+			Response struct {
+				Any []struct {
+					XMLName xml.Name
+					Value   string `xml:",chardata"`
+				} `xml:",any"`
+			} `xml:",any"`
+		} `xml:"Body"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return nil, err
+	}
+	out := make(map[string]string, len(env.Body.Response.Any))
+	for _, a := range env.Body.Response.Any {
+		out[a.XMLName.Local] = a.Value
+	}
+	return out, nil
+}
+
+// localAddrFor returns the local IP address the host would use to reach
+// controlURL's gateway, by dialing it and reading back the outbound
+// connection's address; nothing is sent, so this works even for
+// connectionless protocols like UDP.
+func localAddrFor(controlURL string) (string, error) {
+	u, err := url.Parse(controlURL)
+	if err != nil {
+		return "", fmt.Errorf("nat: invalid control URL %q: %w", controlURL, err)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("nat: control URL %q has no host", controlURL)
+	}
+	conn, err := net.Dial("udp", u.Host)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
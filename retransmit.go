@@ -0,0 +1,49 @@
+package turn
+
+import (
+	"sync"
+	"time"
+
+	"gortc.io/stun"
+)
+
+// retransmitAgent wraps a stun.ClientAgent and calls onRetransmit
+// whenever Start is invoked for a transaction ID that is already
+// in-flight. The STUN client's retransmission loop re-calls Start for
+// the same ID on every retry (see stun.Client's handleAgentCallback),
+// so a repeated Start is exactly a retransmission; this is the
+// extension point stun.ClientAgent offers in place of the retransmit
+// hook earlier STUN client APIs exposed directly.
+type retransmitAgent struct {
+	stun.ClientAgent
+	onRetransmit func()
+
+	mux     sync.Mutex
+	pending map[[stun.TransactionIDSize]byte]struct{}
+}
+
+func newRetransmitAgent(a stun.ClientAgent, onRetransmit func()) *retransmitAgent {
+	return &retransmitAgent{
+		ClientAgent:  a,
+		onRetransmit: onRetransmit,
+		pending:      make(map[[stun.TransactionIDSize]byte]struct{}),
+	}
+}
+
+func (a *retransmitAgent) Start(id [stun.TransactionIDSize]byte, deadline time.Time) error {
+	a.mux.Lock()
+	_, inFlight := a.pending[id]
+	a.pending[id] = struct{}{}
+	a.mux.Unlock()
+	if inFlight {
+		a.onRetransmit()
+	}
+	return a.ClientAgent.Start(id, deadline)
+}
+
+func (a *retransmitAgent) Stop(id [stun.TransactionIDSize]byte) error {
+	a.mux.Lock()
+	delete(a.pending, id)
+	a.mux.Unlock()
+	return a.ClientAgent.Stop(id)
+}
@@ -0,0 +1,250 @@
+package turn
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	gturn "gortc.io/turn"
+)
+
+// ErrChannelQueueFull is returned by sendChan when a channel's send
+// queue is at its capacity (defaultSendQueueCapacity unless
+// Allocation.SetChannelQueueCapacity changed it) and cannot accept more
+// data.
+var ErrChannelQueueFull = errors.New("turn: channel send queue is full")
+
+const (
+	defaultSendQueueCapacity = 64
+	defaultFlushInterval     = 100 * time.Millisecond
+)
+
+// ChannelStats holds egress and ingress counters for a single channel,
+// as seen by the scheduler.
+type ChannelStats struct {
+	BytesSent   uint64
+	PacketsSent uint64
+	BytesRecv   uint64
+	PacketsRecv uint64
+	QueueDepth  int
+	Dropped     uint64
+}
+
+// channelQueue is the egress queue for one ChannelNumber: a bounded
+// buffer of pending ChannelData payloads, a priority weighting it
+// against other channels, and a token bucket limiting its byte rate.
+type channelQueue struct {
+	number   gturn.ChannelNumber
+	priority int
+	capacity int
+
+	mux     sync.Mutex
+	limiter *rate.Limiter
+	queue   [][]byte
+	stats   ChannelStats
+}
+
+func newChannelQueue(n gturn.ChannelNumber) *channelQueue {
+	return &channelQueue{
+		number:   n,
+		capacity: defaultSendQueueCapacity,
+		limiter:  rate.NewLimiter(rate.Inf, 0),
+	}
+}
+
+func (q *channelQueue) setRate(bytesPerSec int64) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	if bytesPerSec <= 0 {
+		q.limiter.SetLimit(rate.Inf)
+		return
+	}
+	// The limiter can never admit a single AllowN(n) bigger than its
+	// burst, no matter how long it waits, so a burst pinned to exactly
+	// bytesPerSec would permanently block any already-queued payload
+	// larger than one second's allowance. Burst must cover the largest
+	// payload this queue has seen, not just the configured rate.
+	burst := int(bytesPerSec)
+	for _, d := range q.queue {
+		if len(d) > burst {
+			burst = len(d)
+		}
+	}
+	q.limiter.SetLimit(rate.Limit(bytesPerSec))
+	q.limiter.SetBurst(burst)
+}
+
+func (q *channelQueue) setPriority(p int) {
+	q.mux.Lock()
+	q.priority = p
+	q.mux.Unlock()
+}
+
+func (q *channelQueue) setCapacity(capacity int) {
+	q.mux.Lock()
+	if capacity > 0 {
+		q.capacity = capacity
+	}
+	q.mux.Unlock()
+}
+
+func (q *channelQueue) push(data []byte) bool {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	if len(q.queue) >= q.capacity {
+		q.stats.Dropped++
+		return false
+	}
+	// Same reasoning as setRate: grow the burst rather than let a
+	// single oversized payload sit in the queue forever because the
+	// limiter can never admit it.
+	if limit := q.limiter.Limit(); limit != rate.Inf && len(data) > q.limiter.Burst() {
+		q.limiter.SetBurst(len(data))
+	}
+	q.queue = append(q.queue, data)
+	q.stats.QueueDepth = len(q.queue)
+	return true
+}
+
+func (q *channelQueue) recordRecv(n int) {
+	q.mux.Lock()
+	q.stats.BytesRecv += uint64(n)
+	q.stats.PacketsRecv++
+	q.mux.Unlock()
+}
+
+// scheduler paces ChannelData egress per channel, draining queues
+// weighted by Priority and throttled by each channel's token bucket,
+// and coalesces whatever a flush drains into a single batched write.
+// Modeled on tendermint's MConnection send scheduling.
+type scheduler struct {
+	conn          net.Conn
+	flushInterval time.Duration
+
+	mux      sync.Mutex
+	channels map[gturn.ChannelNumber]*channelQueue
+
+	closeOnce sync.Once
+	closeCh   chan struct{}
+}
+
+func newScheduler(conn net.Conn, flushInterval time.Duration) *scheduler {
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+	s := &scheduler{
+		conn:          conn,
+		flushInterval: flushInterval,
+		channels:      make(map[gturn.ChannelNumber]*channelQueue),
+		closeCh:       make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *scheduler) channel(n gturn.ChannelNumber) *channelQueue {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	q, ok := s.channels[n]
+	if !ok {
+		q = newChannelQueue(n)
+		s.channels[n] = q
+	}
+	return q
+}
+
+func (s *scheduler) setRate(n gturn.ChannelNumber, bytesPerSec int64) {
+	s.channel(n).setRate(bytesPerSec)
+}
+
+func (s *scheduler) setPriority(n gturn.ChannelNumber, priority int) {
+	s.channel(n).setPriority(priority)
+}
+
+func (s *scheduler) setCapacity(n gturn.ChannelNumber, capacity int) {
+	s.channel(n).setCapacity(capacity)
+}
+
+func (s *scheduler) send(n gturn.ChannelNumber, data []byte) bool {
+	return s.channel(n).push(data)
+}
+
+func (s *scheduler) recordRecv(n gturn.ChannelNumber, bytes int) {
+	s.channel(n).recordRecv(bytes)
+}
+
+func (s *scheduler) stats(n gturn.ChannelNumber) ChannelStats {
+	q := s.channel(n)
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	return q.stats
+}
+
+func (s *scheduler) close() {
+	s.closeOnce.Do(func() { close(s.closeCh) })
+}
+
+func (s *scheduler) run() {
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closeCh:
+			return
+		case <-ticker.C:
+			s.flush()
+		}
+	}
+}
+
+// flush drains every channel's queue, highest Priority first, coalesces
+// the ChannelData frames it is able to send within each channel's rate
+// budget into one write, and pushes anything left over back for the
+// next tick.
+func (s *scheduler) flush() {
+	s.mux.Lock()
+	queues := make([]*channelQueue, 0, len(s.channels))
+	for _, q := range s.channels {
+		queues = append(queues, q)
+	}
+	s.mux.Unlock()
+
+	sort.Slice(queues, func(i, j int) bool { return queues[i].priority > queues[j].priority })
+
+	now := time.Now()
+	var batch []byte
+	for _, q := range queues {
+		q.mux.Lock()
+		pending := q.queue
+		q.queue = nil
+		q.stats.QueueDepth = 0
+		q.mux.Unlock()
+		var leftover [][]byte
+		for i, data := range pending {
+			if !q.limiter.AllowN(now, len(data)) {
+				leftover = pending[i:]
+				break
+			}
+			d := &gturn.ChannelData{Data: data, Number: q.number}
+			d.Encode()
+			batch = append(batch, d.Raw...)
+			q.mux.Lock()
+			q.stats.BytesSent += uint64(len(data))
+			q.stats.PacketsSent++
+			q.mux.Unlock()
+		}
+		if len(leftover) > 0 {
+			q.mux.Lock()
+			q.queue = append(leftover, q.queue...)
+			q.stats.QueueDepth = len(q.queue)
+			q.mux.Unlock()
+		}
+	}
+	if len(batch) == 0 {
+		return
+	}
+	_, _ = s.conn.Write(batch)
+}
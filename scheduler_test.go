@@ -0,0 +1,60 @@
+package turn
+
+import "testing"
+
+func TestChannelQueueSetRateGrowsBurstForQueuedPayload(t *testing.T) {
+	q := newChannelQueue(1)
+	big := make([]byte, 4096)
+	if !q.push(big) {
+		t.Fatal("push of first payload should have succeeded against an unlimited queue")
+	}
+
+	// bytesPerSec is smaller than the already-queued payload; setRate must
+	// not pin the burst to bytesPerSec or this payload could never be sent.
+	q.setRate(1024)
+
+	if got := q.limiter.Burst(); got < len(big) {
+		t.Fatalf("limiter.Burst() = %d, want >= %d", got, len(big))
+	}
+}
+
+func TestChannelQueuePushGrowsBurstForOversizedPayload(t *testing.T) {
+	q := newChannelQueue(1)
+	q.setRate(1024)
+
+	big := make([]byte, 4096)
+	if !q.push(big) {
+		t.Fatal("push() = false, want true: an oversized payload should still be queued, not blocked forever")
+	}
+	if got := q.limiter.Burst(); got < len(big) {
+		t.Fatalf("limiter.Burst() = %d, want >= %d", got, len(big))
+	}
+}
+
+func TestChannelQueuePushRespectsCapacity(t *testing.T) {
+	q := newChannelQueue(1)
+	q.setCapacity(1)
+
+	if !q.push([]byte("a")) {
+		t.Fatal("first push should fit within capacity 1")
+	}
+	if q.push([]byte("b")) {
+		t.Fatal("second push should have been dropped: queue is at capacity")
+	}
+	if q.stats.Dropped != 1 {
+		t.Fatalf("stats.Dropped = %d, want 1", q.stats.Dropped)
+	}
+}
+
+func TestChannelQueueRecordRecv(t *testing.T) {
+	q := newChannelQueue(1)
+	q.recordRecv(10)
+	q.recordRecv(5)
+
+	if q.stats.BytesRecv != 15 {
+		t.Fatalf("stats.BytesRecv = %d, want 15", q.stats.BytesRecv)
+	}
+	if q.stats.PacketsRecv != 2 {
+		t.Fatalf("stats.PacketsRecv = %d, want 2", q.stats.PacketsRecv)
+	}
+}
@@ -0,0 +1,121 @@
+package turn
+
+import (
+	"sync/atomic"
+	"time"
+
+	gturn "gortc.io/turn"
+)
+
+// MetricsSink lets callers bridge Client counters to an external
+// metrics system (Prometheus, OpenTelemetry, ...) without this package
+// importing either.
+type MetricsSink interface {
+	Observe(name string, v float64, labels ...string)
+}
+
+// Stats is a point-in-time snapshot of the counters a Client
+// accumulates across all of its allocations, modeled on anacrolix/
+// torrent's ConnStats.
+type Stats struct {
+	BytesSent        int64
+	BytesRecv        int64
+	SendBytesSent    int64 // sent via a Send indication
+	ChannelBytesSent int64 // sent via gturn.ChannelData
+	PacketsSent      int64
+	PacketsRecv      int64
+
+	Retransmissions int64
+
+	PermissionsInstalled int64
+	ChannelsBound        int64
+	RefreshSuccesses     int64
+	RefreshFailures      int64
+}
+
+// clientStats holds the running totals backing Client.Stats as
+// independent atomic int64s, so updating them never takes c.mux.
+type clientStats struct {
+	bytesSent        int64
+	bytesRecv        int64
+	sendBytesSent    int64
+	channelBytesSent int64
+	packetsSent      int64
+	packetsRecv      int64
+	retransmissions  int64
+	permsInstalled   int64
+	channelsBound    int64
+	refreshOK        int64
+	refreshFail      int64
+}
+
+func (s *clientStats) snapshot() Stats {
+	return Stats{
+		BytesSent:            atomic.LoadInt64(&s.bytesSent),
+		BytesRecv:            atomic.LoadInt64(&s.bytesRecv),
+		SendBytesSent:        atomic.LoadInt64(&s.sendBytesSent),
+		ChannelBytesSent:     atomic.LoadInt64(&s.channelBytesSent),
+		PacketsSent:          atomic.LoadInt64(&s.packetsSent),
+		PacketsRecv:          atomic.LoadInt64(&s.packetsRecv),
+		Retransmissions:      atomic.LoadInt64(&s.retransmissions),
+		PermissionsInstalled: atomic.LoadInt64(&s.permsInstalled),
+		ChannelsBound:        atomic.LoadInt64(&s.channelsBound),
+		RefreshSuccesses:     atomic.LoadInt64(&s.refreshOK),
+		RefreshFailures:      atomic.LoadInt64(&s.refreshFail),
+	}
+}
+
+// Stats returns a snapshot of the counters the Client has accumulated
+// across all of its allocations.
+func (c *Client) Stats() Stats { return c.stats.snapshot() }
+
+func (c *Client) observe(name string, v float64, labels ...string) {
+	if c.metrics != nil {
+		c.metrics.Observe(name, v, labels...)
+	}
+}
+
+// onRetransmit is passed to the STUN client as a retransmission hook so
+// Client.Stats can report it.
+func (c *Client) onRetransmit() {
+	atomic.AddInt64(&c.stats.retransmissions, 1)
+	c.observe("turn_retransmissions_total", 1)
+}
+
+// PeerStats accumulates byte counters for a single peer permission.
+type PeerStats struct {
+	BytesSent int64
+	BytesRecv int64
+}
+
+// AllocStats is a point-in-time snapshot of the counters for a single
+// Allocation, including a breakdown by peer.
+type AllocStats struct {
+	BytesSent         int64
+	BytesRecv         int64
+	LifetimeRemaining time.Duration
+	Peers             map[string]PeerStats
+}
+
+// Stats returns a snapshot of the counters accumulated for this
+// allocation and its permissions.
+func (a *Allocation) Stats() AllocStats {
+	a.mux.RLock()
+	defer a.mux.RUnlock()
+	out := AllocStats{
+		Peers: make(map[string]PeerStats, len(a.perms)),
+	}
+	if !a.expiresAt.IsZero() {
+		if remaining := time.Until(a.expiresAt); remaining > 0 {
+			out.LifetimeRemaining = remaining
+		}
+	}
+	for _, p := range a.perms {
+		sent := atomic.LoadInt64(&p.bytesSent)
+		recv := atomic.LoadInt64(&p.bytesRecv)
+		out.BytesSent += sent
+		out.BytesRecv += recv
+		out.Peers[gturn.Addr(p.peerAddr).String()] = PeerStats{BytesSent: sent, BytesRecv: recv}
+	}
+	return out
+}
@@ -0,0 +1,168 @@
+package turn
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/pion/dtls/v2"
+	gturn "gortc.io/turn"
+)
+
+// Dial connects to a TURN server over network and returns a ready
+// Client talking to it. Supported networks are "udp" (RFC 5389 UDP
+// transport), "tcp" (RFC 6062 TCP transport, length-framed), "tls"
+// (TURNS, RFC 5928) and "dtls" (TURN-over-DTLS, RFC 7350).
+//
+// o.Conn is ignored; Dial fills it in from the dialed connection.
+func Dial(network, addr string, o ClientOptions) (*Client, error) {
+	conn, err := dialTransport(network, addr, o)
+	if err != nil {
+		return nil, err
+	}
+	o.Conn = conn
+	return NewClient(o)
+}
+
+func dialTransport(network, addr string, o ClientOptions) (net.Conn, error) {
+	switch network {
+	case "udp":
+		return net.Dial("udp", addr)
+	case "tcp":
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return newFramedConn(conn), nil
+	case "tls":
+		tlsConfig := o.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		conn, err := tls.Dial("tcp", addr, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		return newFramedConn(conn), nil
+	case "dtls":
+		udpAddr, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			return nil, err
+		}
+		udpConn, err := net.DialUDP("udp", nil, udpAddr)
+		if err != nil {
+			return nil, err
+		}
+		dtlsConfig := o.DTLSConfig
+		if dtlsConfig == nil {
+			dtlsConfig = &dtls.Config{}
+		}
+		return dtls.Client(udpConn, dtlsConfig)
+	default:
+		return nil, fmt.Errorf("turn: unsupported network %q", network)
+	}
+}
+
+const (
+	stunHeaderLen        = 20
+	channelDataHeaderLen = 4
+	// channelDataPad is the 4-byte alignment RFC 6062 Section 4.3
+	// requires ChannelData datagrams to be padded to on stream
+	// transports.
+	channelDataPad = 4
+
+	// maxFrameSize is the largest a single STUN message or ChannelData
+	// datagram can ever be: a 20-byte STUN header plus the largest
+	// Message Length a 16-bit field can declare (RFC 5389 Section 6;
+	// RFC 5766 Section 11.4 uses the same width for ChannelData's
+	// Length). UDP datagrams are already bounded well below this by the
+	// network, so a read buffer sized to maxFrameSize is always big
+	// enough regardless of which transport Dial is using, unlike a flat
+	// 1500-byte guess that only happens to cover typical UDP traffic.
+	maxFrameSize = stunHeaderLen + 1<<16 - 1
+)
+
+// framedConn wraps a stream-oriented net.Conn (TCP, TLS) so Read returns
+// exactly one STUN message or one ChannelData datagram per call, the
+// way readUntilClosed expects regardless of transport. Neither format
+// needs an extra length prefix invented for this purpose: a STUN
+// message carries its Message Length at bytes [2:4) of its 20-byte
+// header (RFC 5389 Section 6), and a ChannelData datagram carries its
+// Length at the same offset in its 4-byte header (RFC 5766 Section
+// 11.4), so framedConn peeks those four bytes, decides which header it
+// has, and reads exactly the payload length the message itself
+// declares. This is the framing RFC 6062 Section 4.3 describes for TCP
+// and what any compliant TURN server already emits, so it needs no
+// server-side cooperation beyond RFC 6062 itself.
+type framedConn struct {
+	net.Conn
+}
+
+func newFramedConn(conn net.Conn) *framedConn {
+	return &framedConn{Conn: conn}
+}
+
+// Read blocks until it can return exactly one frame: it reads the
+// common 4-byte prefix STUN and ChannelData headers share, decides
+// which kind of message it is from the first two bits (0b00 is STUN,
+// 0b01 is ChannelData per RFC 5766 Section 11), then reads the
+// remaining header and payload bytes the message itself declares.
+func (f *framedConn) Read(p []byte) (int, error) {
+	var prefix [4]byte
+	if _, err := io.ReadFull(f.Conn, prefix[:]); err != nil {
+		return 0, err
+	}
+	if gturn.IsChannelData(prefix[:]) {
+		return f.readChannelData(p, prefix)
+	}
+	return f.readSTUN(p, prefix)
+}
+
+func (f *framedConn) readSTUN(p []byte, prefix [4]byte) (int, error) {
+	body := int(binary.BigEndian.Uint16(prefix[2:4]))
+	total := stunHeaderLen + body
+	if len(p) < total {
+		return 0, f.shortBuffer(total - len(prefix))
+	}
+	copy(p, prefix[:])
+	if _, err := io.ReadFull(f.Conn, p[4:total]); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+func (f *framedConn) readChannelData(p []byte, prefix [4]byte) (int, error) {
+	body := int(binary.BigEndian.Uint16(prefix[2:4]))
+	padded := body
+	if rem := padded % channelDataPad; rem != 0 {
+		padded += channelDataPad - rem
+	}
+	total := channelDataHeaderLen + padded
+	if len(p) < channelDataHeaderLen+body {
+		return 0, f.shortBuffer(total - len(prefix))
+	}
+	copy(p, prefix[:])
+	if _, err := io.ReadFull(f.Conn, p[4:total]); err != nil {
+		return 0, err
+	}
+	// Report only the unpadded length; callers (IsChannelData/Decode)
+	// read the Length field themselves, not len(p).
+	return channelDataHeaderLen + body, nil
+}
+
+// shortBuffer discards the remaining n bytes of a frame whose header
+// has already been consumed from the wire before reporting
+// io.ErrShortBuffer, so the stream stays aligned on the next frame
+// instead of desyncing on the leftover bytes.
+func (f *framedConn) shortBuffer(n int) error {
+	if _, err := io.CopyN(io.Discard, f.Conn, int64(n)); err != nil {
+		return err
+	}
+	return io.ErrShortBuffer
+}
+
+func (f *framedConn) Write(p []byte) (int, error) {
+	return f.Conn.Write(p)
+}